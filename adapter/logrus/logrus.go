@@ -0,0 +1,52 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package logrus adapts a caller-owned *logrus.Logger to pool.Logger, for
+// callers that want ExecPool's log events on their own logrus instance
+// (with its own hooks/formatter/level) rather than the minimal stderr
+// logger ExecPool uses by default.
+package logrus
+
+import (
+	"github.com/sirupsen/logrus"
+	pool "github.com/tim-timpani/go-exec-pool"
+)
+
+type adapter struct {
+	entry *logrus.Entry
+}
+
+// New wraps logger as a pool.Logger.
+func New(logger *logrus.Logger) pool.Logger {
+	return adapter{entry: logrus.NewEntry(logger)}
+}
+
+func (a adapter) Debugf(format string, args ...interface{}) { a.entry.Debugf(format, args...) }
+func (a adapter) Infof(format string, args ...interface{})  { a.entry.Infof(format, args...) }
+func (a adapter) Warnf(format string, args ...interface{})  { a.entry.Warnf(format, args...) }
+func (a adapter) Errorf(format string, args ...interface{}) { a.entry.Errorf(format, args...) }
+
+func (a adapter) With(fields ...pool.Field) pool.Logger {
+	logrusFields := make(logrus.Fields, len(fields))
+	for _, f := range fields {
+		logrusFields[f.Key] = f.Value
+	}
+	return adapter{entry: a.entry.WithFields(logrusFields)}
+}
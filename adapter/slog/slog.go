@@ -0,0 +1,66 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package slog adapts a *slog.Logger to pool.Logger, for callers on
+// log/slog. slog has no Debugf/Infof-style helpers, so each call is
+// formatted with fmt.Sprintf before being passed through at the matching
+// slog level.
+package slog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	pool "github.com/tim-timpani/go-exec-pool"
+)
+
+type adapter struct {
+	logger *slog.Logger
+}
+
+// New wraps logger as a pool.Logger.
+func New(logger *slog.Logger) pool.Logger {
+	return adapter{logger: logger}
+}
+
+func (a adapter) Debugf(format string, args ...interface{}) {
+	a.logger.Log(context.Background(), slog.LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (a adapter) Infof(format string, args ...interface{}) {
+	a.logger.Log(context.Background(), slog.LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (a adapter) Warnf(format string, args ...interface{}) {
+	a.logger.Log(context.Background(), slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (a adapter) Errorf(format string, args ...interface{}) {
+	a.logger.Log(context.Background(), slog.LevelError, fmt.Sprintf(format, args...))
+}
+
+func (a adapter) With(fields ...pool.Field) pool.Logger {
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		args = append(args, f.Key, f.Value)
+	}
+	return adapter{logger: a.logger.With(args...)}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package zap adapts a *zap.SugaredLogger to pool.Logger, for callers on
+// uber-go/zap.
+package zap
+
+import (
+	pool "github.com/tim-timpani/go-exec-pool"
+	"go.uber.org/zap"
+)
+
+type adapter struct {
+	sugar *zap.SugaredLogger
+}
+
+// New wraps logger as a pool.Logger.
+func New(logger *zap.SugaredLogger) pool.Logger {
+	return adapter{sugar: logger}
+}
+
+func (a adapter) Debugf(format string, args ...interface{}) { a.sugar.Debugf(format, args...) }
+func (a adapter) Infof(format string, args ...interface{})  { a.sugar.Infof(format, args...) }
+func (a adapter) Warnf(format string, args ...interface{})  { a.sugar.Warnf(format, args...) }
+func (a adapter) Errorf(format string, args ...interface{}) { a.sugar.Errorf(format, args...) }
+
+func (a adapter) With(fields ...pool.Field) pool.Logger {
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, f := range fields {
+		args = append(args, f.Key, f.Value)
+	}
+	return adapter{sugar: a.sugar.With(args...)}
+}
@@ -22,33 +22,73 @@ package pool
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"github.com/robfig/cron/v3"
+	"github.com/tim-timpani/go-exec-pool/queue"
 	"math/rand"
 	"os/exec"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// defaultKillGrace is how long a job gets to exit on its own after being
+// sent SIGTERM (via context cancellation) before the pool sends SIGKILL.
+const defaultKillGrace = 5 * time.Second
+
+// ErrJobCanceled is set as CommandResult.RunError when a job was stopped
+// because its context was canceled, its timeout elapsed, or the pool was
+// shut down, rather than because the command itself failed.
+var ErrJobCanceled = errors.New("job canceled")
+
 type ExecPool struct {
-	workerChanIn  chan CommandRequest
-	workerChanOut chan CommandResult
-	executors     int
-	cmdOutput     []CommandResult
-	cmdQueue      []CommandRequest
-	startTime     time.Time
-	endTime       time.Time
-	inputClosed   bool
-	waitGroup     sync.WaitGroup
-	poolId        string
-	cmdEnv        []string
+	workerChanIn      chan CommandRequest
+	workerChanOut     chan CommandResult
+	executors         int
+	cmdOutputMu       sync.Mutex
+	cmdOutput         []CommandResult
+	cmdQueue          []CommandRequest
+	startTime         time.Time
+	endTime           time.Time
+	inputClosed       bool
+	waitGroup         sync.WaitGroup
+	poolId            string
+	cmdEnv            []string
+	ctx               context.Context
+	cancel            context.CancelFunc
+	killGrace         time.Duration
+	runningMu         sync.Mutex
+	running           map[string]*exec.Cmd
+	backend           queue.Backend
+	cronRunner        *cron.Cron
+	broadcastersMu    sync.Mutex
+	broadcasters      map[string]*logBroadcaster
+	logger            Logger
+	progressCh        chan ProgressEvent
+	progressOnce      sync.Once
+	progressCloseOnce sync.Once
+	queuedEventsMu    sync.Mutex
+	queuedEvents      []ProgressEvent
+	heartbeatInterval time.Duration
+	retryPolicy       RetryPolicy
+	retryQueue        *retryQueue
+	retryDone         chan struct{}
+	pendingCount      int64
+	closeOnce         sync.Once
+	telemetry         *telemetry
 }
 
 type CommandRequest struct {
 	jobSequence int
 	jobId       string
 	command     *exec.Cmd
+	timeout     time.Duration
+	retryPolicy *RetryPolicy
+	attempt     int
+	attempts    []AttemptRecord
 }
 
 type CommandResult struct {
@@ -58,25 +98,50 @@ type CommandResult struct {
 	StdOut      string
 	StdErr      string
 	ReturnCode  int
+	Attempt     int
+	Attempts    []AttemptRecord
 }
 
 func NewExecPool(executors int) *ExecPool {
 	return &ExecPool{
-		executors:   executors,
-		inputClosed: false,
-		poolId:      fmt.Sprintf("%s", RandomString(12)),
+		executors:         executors,
+		inputClosed:       false,
+		poolId:            fmt.Sprintf("%s", RandomString(12)),
+		killGrace:         defaultKillGrace,
+		running:           make(map[string]*exec.Cmd),
+		logger:            newDefaultLogger(),
+		heartbeatInterval: defaultHeartbeatInterval,
+		retryPolicy:       DefaultRetryPolicy(),
+		telemetry:         newTelemetry(),
 	}
 }
 
+// SetKillGrace overrides how long a canceled or timed-out job is given to
+// exit after SIGTERM before the pool escalates to SIGKILL.
+func (e *ExecPool) SetKillGrace(grace time.Duration) {
+	e.killGrace = grace
+}
+
 func (e *ExecPool) AddCommand(cmd *exec.Cmd) (id string) {
+	return e.AddCommandWithTimeout(cmd, 0)
+}
+
+// AddCommandWithTimeout queues cmd the same way AddCommand does, but the
+// worker that runs it will cancel it (SIGTERM, then SIGKILL after the pool's
+// kill grace) if it has not finished within timeout. A timeout of 0 means
+// no per-job deadline.
+func (e *ExecPool) AddCommandWithTimeout(cmd *exec.Cmd, timeout time.Duration) (id string) {
 	seq := len(e.cmdQueue)
 	id = fmt.Sprintf("%s-%012d-%s", time.Now().Format(time.RFC3339Nano), seq, e.poolId)
 	cmdRequest := CommandRequest{
 		jobSequence: seq,
 		jobId:       id,
 		command:     cmd,
+		timeout:     timeout,
 	}
-	log.Debugf("job %s queues", id)
+	e.logger.With(Field{"pool_id", e.poolId}, Field{"job_id", id}).Debugf("job queues")
+	e.emitProgress(ProgressEvent{JobId: id, State: VertexQueued})
+	e.recordEnqueue(context.Background(), id, cmd)
 	e.cmdQueue = append(e.cmdQueue, cmdRequest)
 	return
 }
@@ -90,15 +155,30 @@ func (e *ExecPool) AddEnv(envSetting string) error {
 }
 
 func (e *ExecPool) Start() error {
+	return e.StartContext(context.Background())
+}
+
+// StartContext behaves like Start, but ties the lifetime of every job to
+// ctx: canceling ctx (or its deadline elapsing) sends SIGTERM to every job
+// still running, escalating to SIGKILL after the pool's kill grace.
+func (e *ExecPool) StartContext(ctx context.Context) error {
 
 	if e.inputClosed {
 		return errors.New("can not start again")
 	}
 	e.inputClosed = true
+	e.ctx, e.cancel = context.WithCancel(ctx)
 
-	// Create the channels
+	// Create the channels. workerChanIn is closed once pendingCount (which
+	// accounts for both the initial batch and any jobs currently waiting
+	// out a retry backoff) reaches zero, rather than as soon as the
+	// initial batch is fed in, so retries have somewhere to land.
 	e.workerChanIn = make(chan CommandRequest, len(e.cmdQueue))
 	e.workerChanOut = make(chan CommandResult, len(e.cmdQueue))
+	e.pendingCount = int64(len(e.cmdQueue))
+	e.retryQueue = newRetryQueue()
+	e.retryDone = make(chan struct{})
+	go e.runRetryDispatcher(e.retryDone)
 
 	// Add each command from the queue into the input channel for the workers
 	for _, jobRequest := range e.cmdQueue {
@@ -109,10 +189,14 @@ func (e *ExecPool) Start() error {
 			jobSequence: jobRequest.jobSequence,
 			jobId:       jobRequest.jobId,
 			command:     jobRequest.command,
+			timeout:     jobRequest.timeout,
+			retryPolicy: jobRequest.retryPolicy,
 		}
 		e.workerChanIn <- job
 	}
-	close(e.workerChanIn)
+	if len(e.cmdQueue) == 0 {
+		e.closeWorkerChan()
+	}
 
 	e.startTime = time.Now()
 
@@ -126,6 +210,60 @@ func (e *ExecPool) Start() error {
 
 }
 
+// closeWorkerChan closes workerChanIn and stops the retry dispatcher. It
+// is called exactly once, as soon as pendingCount reaches zero.
+func (e *ExecPool) closeWorkerChan() {
+	e.closeOnce.Do(func() {
+		close(e.retryDone)
+		close(e.workerChanIn)
+	})
+}
+
+// jobResolved marks one job (initial attempt or retry) as terminally
+// done - no further retry will be scheduled for it - and closes
+// workerChanIn once every job the pool knows about has resolved.
+func (e *ExecPool) jobResolved() {
+	if atomic.AddInt64(&e.pendingCount, -1) == 0 {
+		e.closeWorkerChan()
+	}
+}
+
+// Shutdown stops the pool from handing out any more queued jobs, cancels the
+// pool's context so running jobs receive SIGTERM, and waits up to grace for
+// them to exit before force-killing whatever is left.
+func (e *ExecPool) Shutdown(grace time.Duration) error {
+	if !e.inputClosed {
+		return errors.New("can not shut down a pool that has not started")
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		e.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		e.closeProgress()
+		return nil
+	case <-time.After(grace):
+	}
+
+	e.runningMu.Lock()
+	for jobId, cmd := range e.running {
+		e.logger.With(Field{"pool_id", e.poolId}, Field{"job_id", jobId}).Debugf("shutdown grace expired, killing job")
+		_ = cmd.Process.Kill()
+	}
+	e.runningMu.Unlock()
+
+	<-done
+	e.closeProgress()
+	return nil
+}
+
 func (e *ExecPool) Wait() error {
 	if !e.inputClosed {
 		return errors.New("attempting to wait for jobs that have not started")
@@ -136,47 +274,201 @@ func (e *ExecPool) Wait() error {
 	close(e.workerChanOut)
 
 	// Save output from the jobs
+	e.cmdOutputMu.Lock()
 	for workerOutput := range e.workerChanOut {
 		e.cmdOutput = append(e.cmdOutput, workerOutput)
 	}
+	e.cmdOutputMu.Unlock()
 
 	// Save stats
 	e.endTime = time.Now()
 	et := e.endTime.Sub(e.startTime)
-	log.Debugf("total elapsed time %f seconds", et.Seconds())
+	e.logger.With(Field{"pool_id", e.poolId}, Field{"duration_ms", et.Milliseconds()}).Debugf("pool finished")
+	e.closeProgress()
 	return nil
 }
 
+// GetResults returns the result of jobId, checking this process's own
+// in-memory output first and falling back to the pool's Backend (if any)
+// so a separate process driving the same durable backend - e.g. one
+// calling ScheduleCommand while another runs RunDaemon - can retrieve
+// results it never ran itself.
 func (e *ExecPool) GetResults(jobId string) *CommandResult {
+	e.cmdOutputMu.Lock()
 	for _, output := range e.cmdOutput {
 		if output.JobId == jobId {
+			e.cmdOutputMu.Unlock()
 			return &output
 		}
 	}
-	return nil
+	e.cmdOutputMu.Unlock()
+
+	if e.backend == nil {
+		return nil
+	}
+	result, ok, err := e.backend.GetResult(e.poolId, jobId)
+	if err != nil || !ok {
+		return nil
+	}
+	commandResult := &CommandResult{
+		JobId:      result.JobId,
+		StdOut:     result.StdOut,
+		StdErr:     result.StdErr,
+		ReturnCode: result.ReturnCode,
+	}
+	if result.RunError != "" {
+		commandResult.RunError = errors.New(result.RunError)
+	}
+	return commandResult
 }
 
 func (e *ExecPool) worker(wg *sync.WaitGroup) {
 	workerId := "worker-" + RandomString(8)
 	for job := range e.workerChanIn {
-		log.Debugf("%s starting job %s", workerId, job.jobId)
-		outBuff := bytes.Buffer{}
-		errBuff := bytes.Buffer{}
-		job.command.Stdout = &outBuff
-		job.command.Stderr = &errBuff
-		runErr := job.command.Run()
-		output := CommandResult{
-			JobId:      job.jobId,
-			RunError:   runErr,
-			StdOut:     outBuff.String(),
-			StdErr:     errBuff.String(),
-			ReturnCode: job.command.ProcessState.ExitCode(),
+		e.logger.With(Field{"worker_id", workerId}, Field{"job_id", job.jobId}).Debugf("starting job")
+		result := e.runJob(workerId, job)
+		retried, attempts := e.scheduleRetry(job, result)
+		if retried {
+			continue
 		}
-		e.workerChanOut <- output
+		e.jobResolved()
+		result.Attempt = job.attempt
+		result.Attempts = attempts
+		e.workerChanOut <- result
 	}
 	wg.Done()
 }
 
+// runJob runs a single job to completion, tying it to the pool's context
+// (set by StartContext/Shutdown) and the job's own timeout, if any. If the
+// job is canceled or times out, it is sent SIGTERM and, if it has not exited
+// within the pool's kill grace, SIGKILL.
+func (e *ExecPool) runJob(workerId string, job CommandRequest) CommandResult {
+	outBuff := bytes.Buffer{}
+	errBuff := bytes.Buffer{}
+	broadcaster := e.broadcasterFor(job.jobId)
+	stdoutWriter, closeStdout := newStreamWriter(job.jobId, "stdout", &outBuff, broadcaster)
+	stderrWriter, closeStderr := newStreamWriter(job.jobId, "stderr", &errBuff, broadcaster)
+	job.command.Stdout = stdoutWriter
+	job.command.Stderr = stderrWriter
+	defer func() {
+		closeStdout()
+		closeStderr()
+		broadcaster.close()
+		e.releaseBroadcaster(job.jobId)
+	}()
+
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if job.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	ctx, span := e.startJobSpan(ctx, job.jobId, workerId, job.command, job.attempt)
+
+	result := CommandResult{
+		JobId: job.jobId,
+	}
+
+	if ctx.Err() != nil {
+		// The pool was shut down (or this job's own timeout already
+		// elapsed) before a worker got to it. Mark it canceled instead of
+		// starting a process only to immediately SIGTERM it.
+		result.RunError = ErrJobCanceled
+		e.emitProgress(ProgressEvent{JobId: job.jobId, State: VertexFailed, WorkerId: workerId})
+		e.endJobSpan(span, start, result)
+		return result
+	}
+
+	if err := job.command.Start(); err != nil {
+		result.RunError = err
+		e.endJobSpan(span, start, result)
+		return result
+	}
+	e.emitProgress(ProgressEvent{JobId: job.jobId, State: VertexRunning, WorkerId: workerId})
+
+	e.runningMu.Lock()
+	e.running[job.jobId] = job.command
+	e.runningMu.Unlock()
+	defer func() {
+		e.runningMu.Lock()
+		delete(e.running, job.jobId)
+		e.runningMu.Unlock()
+	}()
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	if e.heartbeatInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(e.heartbeatInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-heartbeatDone:
+					return
+				case <-ticker.C:
+					e.emitProgress(ProgressEvent{
+						JobId:    job.jobId,
+						State:    VertexHeartbeat,
+						WorkerId: workerId,
+						LastLine: broadcaster.lastStderrLine(),
+					})
+				}
+			}
+		}()
+	}
+
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- job.command.Wait()
+	}()
+
+	select {
+	case runErr := <-waitDone:
+		result.RunError = runErr
+	case <-ctx.Done():
+		e.logger.With(Field{"job_id", job.jobId}).Debugf("job canceled, sending SIGTERM")
+		_ = job.command.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-waitDone:
+		case <-time.After(e.killGrace):
+			e.logger.With(Field{"job_id", job.jobId}).Debugf("job did not exit within kill grace, sending SIGKILL")
+			_ = job.command.Process.Kill()
+			<-waitDone
+		}
+		result.RunError = ErrJobCanceled
+	}
+
+	result.StdOut = outBuff.String()
+	result.StdErr = errBuff.String()
+	if job.command.ProcessState != nil {
+		result.ReturnCode = job.command.ProcessState.ExitCode()
+	}
+	e.logger.With(
+		Field{"pool_id", e.poolId},
+		Field{"job_id", job.jobId},
+		Field{"exit_code", result.ReturnCode},
+	).Debugf("job finished")
+
+	finalState := VertexCompleted
+	if result.RunError != nil || result.ReturnCode != 0 {
+		finalState = VertexFailed
+	}
+	e.emitProgress(ProgressEvent{
+		JobId:    job.jobId,
+		State:    finalState,
+		WorkerId: workerId,
+		ExitCode: result.ReturnCode,
+	})
+	e.endJobSpan(span, start, result)
+	return result
+}
+
 func RandomString(n int) string {
 	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Field is a structured key/value pair attached to a log call via
+// Logger.With, so pool events can be correlated in whatever observability
+// pipeline the caller already ships logs to.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is the structured logging interface ExecPool emits its events
+// through. Callers with their own logging setup implement this (or use one
+// of the adapters under adapter/) and install it with SetLogger, instead of
+// being forced to take a hard dependency on whatever logging library pool
+// itself might otherwise pick.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	// With returns a Logger that attaches fields to every call it makes,
+	// in addition to any fields already attached by a prior With call.
+	With(fields ...Field) Logger
+}
+
+// SetLogger installs logger as the destination for every log event the
+// pool emits from AddCommand, Start, Wait, and its workers. When not
+// called, the pool logs through stdLogger, a minimal default with no
+// third-party dependency of its own; see the adapter/ subpackages to wire
+// up logrus, zap, or slog instead.
+func (e *ExecPool) SetLogger(logger Logger) {
+	e.logger = logger
+}
+
+// stdLogger is the zero-value default Logger. It writes to stderr through
+// the standard library's log package only, so depending on package pool
+// does not pull in any particular logging library; callers who want one
+// wired up use SetLogger with an adapter/ implementation.
+type stdLogger struct {
+	fields []Field
+	std    *log.Logger
+}
+
+func newDefaultLogger() Logger {
+	return stdLogger{std: log.New(os.Stderr, "", log.LstdFlags)}
+}
+
+func (l stdLogger) logf(level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if len(l.fields) > 0 {
+		parts := make([]string, len(l.fields))
+		for i, f := range l.fields {
+			parts[i] = fmt.Sprintf("%s=%v", f.Key, f.Value)
+		}
+		msg = fmt.Sprintf("%s %s", msg, strings.Join(parts, " "))
+	}
+	l.std.Printf("%s %s", level, msg)
+}
+
+func (l stdLogger) Debugf(format string, args ...interface{}) { l.logf("DEBUG", format, args...) }
+func (l stdLogger) Infof(format string, args ...interface{})  { l.logf("INFO", format, args...) }
+func (l stdLogger) Warnf(format string, args ...interface{})  { l.logf("WARN", format, args...) }
+func (l stdLogger) Errorf(format string, args ...interface{}) { l.logf("ERROR", format, args...) }
+
+func (l stdLogger) With(fields ...Field) Logger {
+	merged := make([]Field, 0, len(l.fields)+len(fields))
+	merged = append(merged, l.fields...)
+	merged = append(merged, fields...)
+	return stdLogger{fields: merged, std: l.std}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"sync"
+	"time"
+)
+
+// VertexState is the lifecycle state of a job in the progress model,
+// borrowed from BuildKit's vertex/status shape: each job is a vertex that
+// moves queued -> running -> completed or failed.
+type VertexState string
+
+const (
+	VertexQueued    VertexState = "queued"
+	VertexRunning   VertexState = "running"
+	VertexHeartbeat VertexState = "heartbeat"
+	VertexCompleted VertexState = "completed"
+	VertexFailed    VertexState = "failed"
+)
+
+// ProgressEvent describes one state change (or heartbeat) of a job vertex.
+type ProgressEvent struct {
+	JobId    string
+	State    VertexState
+	Time     time.Time
+	WorkerId string
+	ExitCode int
+	LastLine string // most recent stderr line, populated on heartbeat events
+}
+
+// defaultProgressBuffer bounds how many unread ProgressEvents Progress will
+// hold before new events are dropped rather than blocking job execution.
+const defaultProgressBuffer = 1024
+
+// defaultHeartbeatInterval is how often a running job emits a heartbeat
+// event when SetHeartbeatInterval has not been called.
+const defaultHeartbeatInterval = 5 * time.Second
+
+// SetHeartbeatInterval overrides how often a running job emits a
+// VertexHeartbeat event carrying its last stderr line, so stalled jobs
+// stay visible to a Progress consumer. A zero interval disables
+// heartbeats.
+func (e *ExecPool) SetHeartbeatInterval(interval time.Duration) {
+	e.heartbeatInterval = interval
+}
+
+// Progress returns a channel of ProgressEvent updates for every job in the
+// pool, usable by a TTY renderer (see progress.TTY) or a JSON logger (see
+// progress.Plain). It can be called any time before Wait/Shutdown finish
+// the pool: any VertexQueued events already emitted by AddCommand before
+// Progress was called are replayed first, so the usual call order
+// (AddCommand... -> Progress -> Start) does not miss them.
+func (e *ExecPool) Progress() <-chan ProgressEvent {
+	e.progressOnce.Do(func() {
+		e.progressCh = make(chan ProgressEvent, defaultProgressBuffer)
+		e.queuedEventsMu.Lock()
+		buffered := e.queuedEvents
+		e.queuedEvents = nil
+		e.queuedEventsMu.Unlock()
+		for _, event := range buffered {
+			select {
+			case e.progressCh <- event:
+			default:
+				e.logger.With(Field{"job_id", event.JobId}).Warnf("dropping progress event, consumer too slow")
+			}
+		}
+	})
+	return e.progressCh
+}
+
+// closeProgress closes the channel returned by Progress, if it was ever
+// created, so a consumer ranging over it (progress.TTY, progress.Plain)
+// returns once the pool is done. Safe to call more than once.
+func (e *ExecPool) closeProgress() {
+	e.progressCloseOnce.Do(func() {
+		if e.progressCh != nil {
+			close(e.progressCh)
+		}
+	})
+}
+
+func (e *ExecPool) emitProgress(event ProgressEvent) {
+	event.Time = time.Now()
+	if e.progressCh == nil {
+		// Progress hasn't been called yet - most likely this is a
+		// VertexQueued event from AddCommand, ahead of the pool's usual
+		// AddCommand...-> Progress -> Start call order. Buffer it so
+		// Progress can replay it once it creates the channel, instead of
+		// silently dropping it here.
+		e.queuedEventsMu.Lock()
+		e.queuedEvents = append(e.queuedEvents, event)
+		e.queuedEventsMu.Unlock()
+		return
+	}
+	select {
+	case e.progressCh <- event:
+	default:
+		e.logger.With(Field{"job_id", event.JobId}).Warnf("dropping progress event, consumer too slow")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package progress
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/containerd/console"
+	pool "github.com/tim-timpani/go-exec-pool"
+)
+
+// workerStatus is the TTY writer's view of one worker's current job.
+type workerStatus struct {
+	jobId     string
+	lastLine  string
+	startTime time.Time
+	done      bool
+}
+
+// TTY draws a live, one-line-per-worker status board on con (typically
+// console.Current()) as events arrive on events, until events is closed.
+// Each line shows the worker's current job id, elapsed time, and last
+// stderr line, refreshed on every event so stalled jobs stay visible.
+func TTY(events <-chan pool.ProgressEvent, con console.Console) error {
+	workers := make(map[string]*workerStatus)
+	var linesDrawn int
+
+	redraw := func() {
+		if linesDrawn > 0 {
+			fmt.Fprintf(con, "\x1b[%dA", linesDrawn)
+		}
+		ids := make([]string, 0, len(workers))
+		for id := range workers {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			w := workers[id]
+			elapsed := time.Since(w.startTime).Round(time.Second)
+			state := "running"
+			if w.done {
+				state = "idle"
+			}
+			fmt.Fprintf(con, "\x1b[2K%s  %-8s  job=%-40s  elapsed=%-8s  %s\n",
+				id, state, w.jobId, elapsed, w.lastLine)
+		}
+		linesDrawn = len(ids)
+	}
+
+	for event := range events {
+		if event.WorkerId == "" {
+			continue
+		}
+		w, ok := workers[event.WorkerId]
+		if !ok {
+			w = &workerStatus{}
+			workers[event.WorkerId] = w
+		}
+
+		switch event.State {
+		case pool.VertexRunning:
+			w.jobId = event.JobId
+			w.startTime = event.Time
+			w.done = false
+		case pool.VertexHeartbeat:
+			w.lastLine = event.LastLine
+		case pool.VertexCompleted, pool.VertexFailed:
+			w.done = true
+		}
+		redraw()
+	}
+	return nil
+}
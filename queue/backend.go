@@ -0,0 +1,88 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package queue defines the durable job queue that ExecPool can be driven
+// from, so that a pool's backlog survives process restarts and can be
+// produced to and consumed from different processes.
+package queue
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Backend implementations when a job referenced
+// by Ack, Nack, or Dequeue no longer exists.
+var ErrNotFound = errors.New("queue: job not found")
+
+// ErrEmpty is returned by Dequeue when there is no job ready to run.
+var ErrEmpty = errors.New("queue: no job ready")
+
+// Job is the durable representation of a queued command. Payload is an
+// opaque, backend-specific encoding of the exec.Cmd and is produced and
+// consumed by the caller (ExecPool encodes/decodes it).
+type Job struct {
+	ID      string
+	PoolId  string
+	Payload []byte
+	RunAt   time.Time
+	Attempt int
+}
+
+// Result is the durable representation of a completed job, published back
+// through the backend so a separate consumer process can retrieve it.
+type Result struct {
+	JobId      string
+	RunError   string
+	StdOut     string
+	StdErr     string
+	ReturnCode int
+}
+
+// Backend is implemented by anything that can durably hold pending jobs for
+// a pool, hand them out for processing with at-least-once delivery, and
+// carry results back to whoever is waiting on them.
+type Backend interface {
+	// Enqueue makes job immediately eligible for Dequeue.
+	Enqueue(job Job) error
+
+	// Schedule makes job eligible for Dequeue no earlier than runAt.
+	Schedule(job Job, runAt time.Time) error
+
+	// Dequeue claims the next ready job for poolId, making it invisible to
+	// other Dequeue callers until the visibility timeout elapses or it is
+	// Acked/Nacked. Returns ErrEmpty if nothing is ready.
+	Dequeue(poolId string) (Job, error)
+
+	// Ack marks a dequeued job as successfully processed and removes it
+	// from the backend.
+	Ack(poolId, jobId string) error
+
+	// Nack returns a dequeued job to the queue for retry, or to a dead
+	// letter set once its attempts are exhausted.
+	Nack(poolId, jobId string, cause error) error
+
+	// PutResult publishes the result of a completed job so that a
+	// separate process can retrieve it with GetResult.
+	PutResult(poolId string, result Result) error
+
+	// GetResult returns the previously published result for jobId, if any.
+	GetResult(poolId, jobId string) (Result, bool, error)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBackend is a Backend that keeps everything in process memory. It
+// reproduces ExecPool's original in-memory queueing behavior and is the
+// default backend when none is configured. It has no visibility timeout:
+// a dequeued job stays claimed until it is Acked or Nacked.
+type MemoryBackend struct {
+	mu          sync.Mutex
+	maxAttempts int
+	pending     map[string][]Job
+	active      map[string]map[string]Job
+	dead        map[string]map[string]Job
+	results     map[string]map[string]Result
+}
+
+// NewMemoryBackend returns an empty MemoryBackend. maxAttempts is how many
+// times a job may be Nacked before it is moved to the dead set instead of
+// retried, matching NewRedisBackend.
+func NewMemoryBackend(maxAttempts int) *MemoryBackend {
+	return &MemoryBackend{
+		maxAttempts: maxAttempts,
+		pending:     make(map[string][]Job),
+		active:      make(map[string]map[string]Job),
+		dead:        make(map[string]map[string]Job),
+		results:     make(map[string]map[string]Result),
+	}
+}
+
+func (m *MemoryBackend) Enqueue(job Job) error {
+	return m.Schedule(job, time.Time{})
+}
+
+func (m *MemoryBackend) Schedule(job Job, runAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.RunAt = runAt
+	m.pending[job.PoolId] = append(m.pending[job.PoolId], job)
+	return nil
+}
+
+func (m *MemoryBackend) Dequeue(poolId string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue := m.pending[poolId]
+	now := time.Now()
+	for i, job := range queue {
+		if !job.RunAt.IsZero() && job.RunAt.After(now) {
+			continue
+		}
+		m.pending[poolId] = append(queue[:i:i], queue[i+1:]...)
+		if m.active[poolId] == nil {
+			m.active[poolId] = make(map[string]Job)
+		}
+		job.Attempt++
+		m.active[poolId][job.ID] = job
+		return job, nil
+	}
+	return Job{}, ErrEmpty
+}
+
+func (m *MemoryBackend) Ack(poolId, jobId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.active[poolId][jobId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.active[poolId], jobId)
+	return nil
+}
+
+func (m *MemoryBackend) Nack(poolId, jobId string, _ error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.active[poolId][jobId]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.active[poolId], jobId)
+
+	if job.Attempt >= m.maxAttempts {
+		if m.dead[poolId] == nil {
+			m.dead[poolId] = make(map[string]Job)
+		}
+		m.dead[poolId][jobId] = job
+		return nil
+	}
+	m.pending[poolId] = append(m.pending[poolId], job)
+	return nil
+}
+
+func (m *MemoryBackend) PutResult(poolId string, result Result) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.results[poolId] == nil {
+		m.results[poolId] = make(map[string]Result)
+	}
+	m.results[poolId][result.JobId] = result
+	return nil
+}
+
+func (m *MemoryBackend) GetResult(poolId, jobId string) (Result, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result, ok := m.results[poolId][jobId]
+	return result, ok, nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendDequeueEmpty(t *testing.T) {
+	m := NewMemoryBackend(3)
+	if _, err := m.Dequeue("pool"); err != ErrEmpty {
+		t.Fatalf("Dequeue on empty backend: got %v, want ErrEmpty", err)
+	}
+}
+
+func TestMemoryBackendEnqueueDequeueAck(t *testing.T) {
+	m := NewMemoryBackend(3)
+	if err := m.Enqueue(Job{ID: "job-1", PoolId: "pool"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	job, err := m.Dequeue("pool")
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if job.ID != "job-1" {
+		t.Fatalf("Dequeue returned job %q, want job-1", job.ID)
+	}
+	if job.Attempt != 1 {
+		t.Fatalf("Dequeue'd job Attempt = %d, want 1", job.Attempt)
+	}
+
+	if _, err := m.Dequeue("pool"); err != ErrEmpty {
+		t.Fatalf("Dequeue while job is active: got %v, want ErrEmpty", err)
+	}
+
+	if err := m.Ack("pool", "job-1"); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if err := m.Ack("pool", "job-1"); err != ErrNotFound {
+		t.Fatalf("Ack on already-Acked job: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryBackendScheduleFuture(t *testing.T) {
+	m := NewMemoryBackend(3)
+	if err := m.Schedule(Job{ID: "job-1", PoolId: "pool"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if _, err := m.Dequeue("pool"); err != ErrEmpty {
+		t.Fatalf("Dequeue before runAt: got %v, want ErrEmpty", err)
+	}
+}
+
+func TestMemoryBackendNackRequeuesUntilMaxAttempts(t *testing.T) {
+	m := NewMemoryBackend(2)
+	if err := m.Enqueue(Job{ID: "job-1", PoolId: "pool"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	// First attempt: Nack should put it back in pending for a retry.
+	job, err := m.Dequeue("pool")
+	if err != nil {
+		t.Fatalf("Dequeue (attempt 1): %v", err)
+	}
+	if job.Attempt != 1 {
+		t.Fatalf("attempt 1 Attempt = %d, want 1", job.Attempt)
+	}
+	if err := m.Nack("pool", job.ID, nil); err != nil {
+		t.Fatalf("Nack (attempt 1): %v", err)
+	}
+
+	job, err = m.Dequeue("pool")
+	if err != nil {
+		t.Fatalf("Dequeue (attempt 2) after Nack: %v", err)
+	}
+	if job.Attempt != 2 {
+		t.Fatalf("attempt 2 Attempt = %d, want 2", job.Attempt)
+	}
+
+	// maxAttempts is 2, so this Nack should dead-letter rather than requeue.
+	if err := m.Nack("pool", job.ID, nil); err != nil {
+		t.Fatalf("Nack (attempt 2): %v", err)
+	}
+	if _, err := m.Dequeue("pool"); err != ErrEmpty {
+		t.Fatalf("Dequeue after exhausting attempts: got %v, want ErrEmpty (job should be dead-lettered)", err)
+	}
+}
+
+func TestMemoryBackendNackUnknownJob(t *testing.T) {
+	m := NewMemoryBackend(3)
+	if err := m.Nack("pool", "missing", nil); err != ErrNotFound {
+		t.Fatalf("Nack on unknown job: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryBackendPutAndGetResult(t *testing.T) {
+	m := NewMemoryBackend(3)
+	if _, ok, err := m.GetResult("pool", "job-1"); ok || err != nil {
+		t.Fatalf("GetResult before PutResult: ok=%v err=%v, want ok=false err=nil", ok, err)
+	}
+
+	want := Result{JobId: "job-1", StdOut: "hi", ReturnCode: 0}
+	if err := m.PutResult("pool", want); err != nil {
+		t.Fatalf("PutResult: %v", err)
+	}
+
+	got, ok, err := m.GetResult("pool", "job-1")
+	if err != nil || !ok {
+		t.Fatalf("GetResult after PutResult: ok=%v err=%v, want ok=true err=nil", ok, err)
+	}
+	if got != want {
+		t.Fatalf("GetResult = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackend is a Backend backed by Redis, using the same reliable-queue
+// shape asynq uses: a pending ZSET scored by ready-time, an active ZSET
+// scored by visibility deadline, and a dead ZSET for jobs that exhausted
+// their attempts. All state for a pool lives under keys namespaced by its
+// pool ID so that many pools can share one Redis instance.
+type RedisBackend struct {
+	client            *redis.Client
+	visibilityTimeout time.Duration
+	maxAttempts       int
+}
+
+// NewRedisBackend wraps client. visibilityTimeout is how long a dequeued job
+// may run before it is considered abandoned and becomes eligible for
+// redelivery; maxAttempts is how many times a job may be Nacked before it is
+// moved to the dead set instead of retried.
+func NewRedisBackend(client *redis.Client, visibilityTimeout time.Duration, maxAttempts int) *RedisBackend {
+	return &RedisBackend{
+		client:            client,
+		visibilityTimeout: visibilityTimeout,
+		maxAttempts:       maxAttempts,
+	}
+}
+
+func (r *RedisBackend) pendingKey(poolId string) string {
+	return fmt.Sprintf("execpool:%s:pending", poolId)
+}
+func (r *RedisBackend) activeKey(poolId string) string {
+	return fmt.Sprintf("execpool:%s:active", poolId)
+}
+func (r *RedisBackend) deadKey(poolId string) string { return fmt.Sprintf("execpool:%s:dead", poolId) }
+func (r *RedisBackend) jobKey(poolId, jobId string) string {
+	return fmt.Sprintf("execpool:%s:job:%s", poolId, jobId)
+}
+func (r *RedisBackend) resultKey(poolId, jobId string) string {
+	return fmt.Sprintf("execpool:%s:result:%s", poolId, jobId)
+}
+
+func (r *RedisBackend) Enqueue(job Job) error {
+	return r.Schedule(job, time.Time{})
+}
+
+func (r *RedisBackend) Schedule(job Job, runAt time.Time) error {
+	ctx := context.Background()
+	job.RunAt = runAt
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	score := float64(runAt.Unix())
+	if runAt.IsZero() {
+		score = float64(time.Now().Unix())
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, r.jobKey(job.PoolId, job.ID), encoded, 0)
+	pipe.ZAdd(ctx, r.pendingKey(job.PoolId), redis.Z{Score: score, Member: job.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// dequeueScript atomically moves the most-overdue ready job from the
+// pending ZSET into the active ZSET (scored by visibility deadline),
+// mirroring asynq's Lua-scripted claim step.
+var dequeueScript = redis.NewScript(`
+local pendingKey = KEYS[1]
+local activeKey = KEYS[2]
+local now = tonumber(ARGV[1])
+local deadline = tonumber(ARGV[2])
+
+local ready = redis.call('ZRANGEBYSCORE', pendingKey, '-inf', now, 'LIMIT', 0, 1)
+if #ready == 0 then
+	return nil
+end
+
+local jobId = ready[1]
+redis.call('ZREM', pendingKey, jobId)
+redis.call('ZADD', activeKey, deadline, jobId)
+return jobId
+`)
+
+func (r *RedisBackend) Dequeue(poolId string) (Job, error) {
+	ctx := context.Background()
+	now := time.Now()
+	deadline := now.Add(r.visibilityTimeout)
+
+	jobId, err := dequeueScript.Run(ctx, r.client,
+		[]string{r.pendingKey(poolId), r.activeKey(poolId)},
+		now.Unix(), deadline.Unix()).Text()
+	if err == redis.Nil {
+		return Job{}, ErrEmpty
+	}
+	if err != nil {
+		return Job{}, err
+	}
+
+	encoded, err := r.client.Get(ctx, r.jobKey(poolId, jobId)).Bytes()
+	if err == redis.Nil {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	if err := json.Unmarshal(encoded, &job); err != nil {
+		return Job{}, err
+	}
+	job.Attempt++
+	encoded, _ = json.Marshal(job)
+	r.client.Set(ctx, r.jobKey(poolId, jobId), encoded, 0)
+	return job, nil
+}
+
+func (r *RedisBackend) Ack(poolId, jobId string) error {
+	ctx := context.Background()
+	pipe := r.client.TxPipeline()
+	removed := pipe.ZRem(ctx, r.activeKey(poolId), jobId)
+	pipe.Del(ctx, r.jobKey(poolId, jobId))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if removed.Val() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *RedisBackend) Nack(poolId, jobId string, _ error) error {
+	ctx := context.Background()
+	encoded, err := r.client.Get(ctx, r.jobKey(poolId, jobId)).Bytes()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var job Job
+	if err := json.Unmarshal(encoded, &job); err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.ZRem(ctx, r.activeKey(poolId), jobId)
+	if job.Attempt >= r.maxAttempts {
+		pipe.ZAdd(ctx, r.deadKey(poolId), redis.Z{Score: float64(time.Now().Unix()), Member: jobId})
+	} else {
+		backoff := time.Duration(job.Attempt*job.Attempt) * time.Second
+		pipe.ZAdd(ctx, r.pendingKey(poolId), redis.Z{Score: float64(time.Now().Add(backoff).Unix()), Member: jobId})
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Reclaim moves every job in poolId's active set whose visibility deadline
+// has passed back to pending for redelivery, or to the dead set if it has
+// already exhausted its attempts. Without this, a daemon that dies or
+// hangs after Dequeue but before Ack/Nack would leave the job claimed
+// forever. Callers should invoke this periodically (see RunDaemon).
+func (r *RedisBackend) Reclaim(poolId string) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	expired, err := r.client.ZRangeByScore(ctx, r.activeKey(poolId), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now.Unix()),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, jobId := range expired {
+		encoded, err := r.client.Get(ctx, r.jobKey(poolId, jobId)).Bytes()
+		if err == redis.Nil {
+			// The job record is gone - it must have been Acked concurrently.
+			r.client.ZRem(ctx, r.activeKey(poolId), jobId)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var job Job
+		if err := json.Unmarshal(encoded, &job); err != nil {
+			return err
+		}
+
+		pipe := r.client.TxPipeline()
+		pipe.ZRem(ctx, r.activeKey(poolId), jobId)
+		if job.Attempt >= r.maxAttempts {
+			pipe.ZAdd(ctx, r.deadKey(poolId), redis.Z{Score: float64(now.Unix()), Member: jobId})
+		} else {
+			pipe.ZAdd(ctx, r.pendingKey(poolId), redis.Z{Score: float64(now.Unix()), Member: jobId})
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisBackend) PutResult(poolId string, result Result) error {
+	ctx := context.Background()
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.resultKey(poolId, result.JobId), encoded, 24*time.Hour).Err()
+}
+
+func (r *RedisBackend) GetResult(poolId, jobId string) (Result, bool, error) {
+	ctx := context.Background()
+	encoded, err := r.client.Get(ctx, r.resultKey(poolId, jobId)).Bytes()
+	if err == redis.Nil {
+		return Result{}, false, nil
+	}
+	if err != nil {
+		return Result{}, false, err
+	}
+	var result Result
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		return Result{}, false, err
+	}
+	return result, true, nil
+}
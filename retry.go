@@ -0,0 +1,252 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// AttemptRecord captures the outcome of a single attempt at a job that was
+// retried, so callers can diagnose flaky commands from CommandResult's
+// full attempt history rather than just its last one.
+type AttemptRecord struct {
+	Attempt    int
+	StdOut     string
+	StdErr     string
+	ReturnCode int
+	RunError   error
+	Time       time.Time
+}
+
+// RetryPolicy controls whether and how a failed job is retried. It can be
+// set pool-wide with SetRetryPolicy or per-job with AddCommandWithRetry.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter scales the full-jitter random backoff: 0 always sleeps the
+	// full computed backoff, 1 sleeps anywhere from 0 up to it.
+	Jitter float64
+
+	// ShouldRetry decides whether a completed attempt should be retried.
+	// Defaults to retrying on a non-zero exit code or a non-nil RunError.
+	ShouldRetry func(CommandResult) bool
+}
+
+// DefaultRetryPolicy never retries: MaxAttempts of 1 preserves ExecPool's
+// original single-shot behavior for callers that don't opt in.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    1,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         1,
+		ShouldRetry: func(r CommandResult) bool {
+			return r.RunError != nil || r.ReturnCode != 0
+		},
+	}
+}
+
+func (p RetryPolicy) shouldRetry(result CommandResult) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(result)
+	}
+	return result.RunError != nil || result.ReturnCode != 0
+}
+
+// backoff computes a full-jitter exponential backoff for the given
+// (zero-based) attempt number, per policy.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	capped := float64(p.MaxBackoff)
+	scaled := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt))
+	if scaled > capped {
+		scaled = capped
+	}
+	jittered := scaled - p.Jitter*scaled*rand.Float64()
+	if jittered < 0 {
+		jittered = 0
+	}
+	return time.Duration(jittered)
+}
+
+// SetRetryPolicy sets the pool's default RetryPolicy, used by every job
+// added with AddCommand/AddCommandWithTimeout. AddCommandWithRetry
+// overrides it for an individual job.
+func (e *ExecPool) SetRetryPolicy(policy RetryPolicy) {
+	e.retryPolicy = policy
+}
+
+// AddCommandWithRetry queues cmd like AddCommand, but runs it under policy
+// instead of the pool's default RetryPolicy.
+func (e *ExecPool) AddCommandWithRetry(cmd *exec.Cmd, policy RetryPolicy) (id string) {
+	id = e.AddCommandWithTimeout(cmd, 0)
+	for i, request := range e.cmdQueue {
+		if request.jobId == id {
+			e.cmdQueue[i].retryPolicy = &policy
+			break
+		}
+	}
+	return id
+}
+
+func (e *ExecPool) retryPolicyFor(job CommandRequest) RetryPolicy {
+	if job.retryPolicy != nil {
+		return *job.retryPolicy
+	}
+	return e.retryPolicy
+}
+
+// delayedJob is one entry in the pool's retry delay-heap: job, waiting to
+// be re-dispatched no earlier than runAt.
+type delayedJob struct {
+	runAt time.Time
+	job   CommandRequest
+}
+
+type delayHeap []delayedJob
+
+func (h delayHeap) Len() int            { return len(h) }
+func (h delayHeap) Less(i, j int) bool  { return h[i].runAt.Before(h[j].runAt) }
+func (h delayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(delayedJob)) }
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// retryQueue is the delay-heap that holds jobs waiting out their backoff
+// before being re-dispatched to the worker pool.
+type retryQueue struct {
+	mu   sync.Mutex
+	heap delayHeap
+	wake chan struct{}
+}
+
+func newRetryQueue() *retryQueue {
+	return &retryQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *retryQueue) schedule(runAt time.Time, job CommandRequest) {
+	q.mu.Lock()
+	heap.Push(&q.heap, delayedJob{runAt: runAt, job: job})
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *retryQueue) peek() (delayedJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.heap) == 0 {
+		return delayedJob{}, false
+	}
+	return q.heap[0], true
+}
+
+func (q *retryQueue) pop() delayedJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return heap.Pop(&q.heap).(delayedJob)
+}
+
+// runRetryDispatcher waits out each queued retry's backoff and then
+// re-enqueues it onto workerChanIn, until done is closed.
+func (e *ExecPool) runRetryDispatcher(done <-chan struct{}) {
+	for {
+		item, ok := e.retryQueue.peek()
+
+		var wait <-chan time.Time
+		var timer *time.Timer
+		if ok {
+			timer = time.NewTimer(time.Until(item.runAt))
+			wait = timer.C
+		}
+
+		select {
+		case <-done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-e.retryQueue.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+			continue
+		case <-wait:
+			e.retryQueue.pop()
+			e.workerChanIn <- item.job
+		}
+	}
+}
+
+// scheduleRetry takes job's latest attempt history (with result appended)
+// and, if policy says the attempt should be retried and attempts remain,
+// schedules the next attempt on the retry delay-heap and returns true.
+// Otherwise it returns false and attempts is job's final attempt history.
+func (e *ExecPool) scheduleRetry(job CommandRequest, result CommandResult) (retried bool, attempts []AttemptRecord) {
+	policy := e.retryPolicyFor(job)
+	attempts = append(job.attempts, newAttemptRecord(job.attempt, result))
+
+	if result.RunError == ErrJobCanceled || !policy.shouldRetry(result) {
+		return false, attempts
+	}
+	if job.attempt+1 >= policy.MaxAttempts {
+		return false, attempts
+	}
+
+	spec := newCommandSpec(job.command)
+	nextJob := CommandRequest{
+		jobSequence: job.jobSequence,
+		jobId:       job.jobId,
+		command:     spec.toCmd(),
+		timeout:     job.timeout,
+		retryPolicy: job.retryPolicy,
+		attempt:     job.attempt + 1,
+		attempts:    attempts,
+	}
+	e.retryQueue.schedule(time.Now().Add(policy.backoff(job.attempt)), nextJob)
+	return true, attempts
+}
+
+func newAttemptRecord(attempt int, result CommandResult) AttemptRecord {
+	return AttemptRecord{
+		Attempt:    attempt,
+		StdOut:     result.StdOut,
+		StdErr:     result.StdErr,
+		ReturnCode: result.ReturnCode,
+		RunError:   result.RunError,
+		Time:       time.Now(),
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoffBounds(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         1,
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		for i := 0; i < 20; i++ {
+			d := policy.backoff(attempt)
+			if d < 0 {
+				t.Fatalf("attempt %d: backoff = %v, want >= 0", attempt, d)
+			}
+			if d > policy.MaxBackoff {
+				t.Fatalf("attempt %d: backoff = %v, want <= MaxBackoff (%v)", attempt, d, policy.MaxBackoff)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyBackoffNoJitter(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0,
+	}
+	if got, want := policy.backoff(0), time.Second; got != want {
+		t.Fatalf("backoff(0) = %v, want %v", got, want)
+	}
+	if got, want := policy.backoff(1), 2*time.Second; got != want {
+		t.Fatalf("backoff(1) = %v, want %v", got, want)
+	}
+	if got, want := policy.backoff(10), 10*time.Second; got != want {
+		t.Fatalf("backoff(10) = %v, want MaxBackoff (%v)", got, want)
+	}
+}
+
+func TestDelayHeapOrdersByRunAt(t *testing.T) {
+	q := newRetryQueue()
+	now := time.Now()
+	q.schedule(now.Add(3*time.Second), CommandRequest{jobId: "third"})
+	q.schedule(now.Add(1*time.Second), CommandRequest{jobId: "first"})
+	q.schedule(now.Add(2*time.Second), CommandRequest{jobId: "second"})
+
+	wantOrder := []string{"first", "second", "third"}
+	for _, want := range wantOrder {
+		item, ok := q.peek()
+		if !ok {
+			t.Fatalf("peek: heap unexpectedly empty, want %q", want)
+		}
+		if item.job.jobId != want {
+			t.Fatalf("peek returned %q, want %q", item.job.jobId, want)
+		}
+		if popped := q.pop(); popped.job.jobId != want {
+			t.Fatalf("pop returned %q, want %q", popped.job.jobId, want)
+		}
+	}
+	if _, ok := q.peek(); ok {
+		t.Fatalf("peek: heap should be empty after popping every entry")
+	}
+}
+
+func newRetryTestPool(policy RetryPolicy) *ExecPool {
+	e := NewExecPool(1)
+	e.retryPolicy = policy
+	e.retryQueue = newRetryQueue()
+	return e
+}
+
+func TestScheduleRetryRetriesUntilMaxAttempts(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     1,
+		ShouldRetry:    func(r CommandResult) bool { return r.ReturnCode != 0 },
+	}
+	e := newRetryTestPool(policy)
+	job := CommandRequest{jobId: "job-1", command: exec.Command("true"), attempt: 0}
+	failure := CommandResult{ReturnCode: 1}
+
+	retried, attempts := e.scheduleRetry(job, failure)
+	if !retried {
+		t.Fatalf("attempt 0 of MaxAttempts=2: retried = false, want true")
+	}
+	if len(attempts) != 1 {
+		t.Fatalf("attempts after 1st failure = %d, want 1", len(attempts))
+	}
+	if _, ok := e.retryQueue.peek(); !ok {
+		t.Fatalf("retry queue should have the next attempt scheduled")
+	}
+
+	next := e.retryQueue.pop()
+	retried, attempts = e.scheduleRetry(next.job, failure)
+	if retried {
+		t.Fatalf("attempt 1 of MaxAttempts=2: retried = true, want false (attempts exhausted)")
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("final attempts = %d, want 2", len(attempts))
+	}
+}
+
+func TestScheduleRetryStopsOnJobCanceled(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     1,
+		ShouldRetry:    func(CommandResult) bool { return true },
+	}
+	e := newRetryTestPool(policy)
+	job := CommandRequest{jobId: "job-1", command: exec.Command("true")}
+
+	retried, _ := e.scheduleRetry(job, CommandResult{RunError: ErrJobCanceled})
+	if retried {
+		t.Fatalf("retried = true for a canceled job, want false")
+	}
+	if _, ok := e.retryQueue.peek(); ok {
+		t.Fatalf("retry queue should stay empty for a canceled job")
+	}
+}
+
+func TestScheduleRetryHonorsShouldRetryFalse(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Multiplier:     1,
+		ShouldRetry:    func(CommandResult) bool { return false },
+	}
+	e := newRetryTestPool(policy)
+	job := CommandRequest{jobId: "job-1", command: exec.Command("true")}
+
+	retried, attempts := e.scheduleRetry(job, CommandResult{ReturnCode: 1})
+	if retried {
+		t.Fatalf("retried = true despite ShouldRetry returning false")
+	}
+	if len(attempts) != 1 {
+		t.Fatalf("attempts = %d, want 1", len(attempts))
+	}
+}
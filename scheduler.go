@@ -0,0 +1,243 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"github.com/tim-timpani/go-exec-pool/queue"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often RunDaemon checks the backend for ready
+// jobs when there is nothing else to wait on.
+const defaultPollInterval = time.Second
+
+// defaultReclaimInterval is how often RunDaemon asks a reclaiming Backend
+// to move back jobs whose visibility timeout expired without an Ack/Nack.
+const defaultReclaimInterval = 30 * time.Second
+
+// defaultMaxAttempts is how many times the pool's default in-memory
+// backend will deliver a job (the first delivery plus redeliveries after
+// a Nack) before a Nack dead-letters it, when no Backend has been
+// configured with SetBackend.
+const defaultMaxAttempts = 5
+
+// reclaimer is implemented by backends (queue.RedisBackend) that can
+// redeliver jobs abandoned by a dead or hung consumer. RunDaemon drives it
+// if the configured Backend happens to support it.
+type reclaimer interface {
+	Reclaim(poolId string) error
+}
+
+// commandSpec is the durable, JSON-encodable representation of an exec.Cmd
+// used as a queue.Job's Payload, since *exec.Cmd itself cannot round-trip
+// through a Backend.
+type commandSpec struct {
+	Path string
+	Args []string
+	Dir  string
+	Env  []string
+}
+
+func newCommandSpec(cmd *exec.Cmd) commandSpec {
+	return commandSpec{Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir, Env: cmd.Env}
+}
+
+func (s commandSpec) toCmd() *exec.Cmd {
+	var args []string
+	if len(s.Args) > 1 {
+		args = s.Args[1:]
+	}
+	cmd := exec.Command(s.Path, args...)
+	cmd.Dir = s.Dir
+	cmd.Env = s.Env
+	return cmd
+}
+
+// SetBackend configures the durable Backend that ScheduleCommand,
+// ScheduleCron, and RunDaemon use. It must be called before Start,
+// StartContext, or RunDaemon. When not called, the pool uses an in-memory
+// backend equivalent to its original cmdQueue behavior.
+func (e *ExecPool) SetBackend(backend queue.Backend) error {
+	if e.inputClosed {
+		return errors.New("can not set backend after jobs have started")
+	}
+	e.backend = backend
+	return nil
+}
+
+func (e *ExecPool) backendOrDefault() queue.Backend {
+	if e.backend == nil {
+		e.backend = queue.NewMemoryBackend(defaultMaxAttempts)
+	}
+	return e.backend
+}
+
+// ScheduleCommand durably enqueues cmd to run at runAt, or immediately if
+// runAt is the zero value, through the pool's Backend. Unlike AddCommand,
+// scheduled jobs survive process restarts when the backend is durable
+// (e.g. queue.RedisBackend), so long-lived worker daemons can pick them up
+// with RunDaemon after a restart.
+func (e *ExecPool) ScheduleCommand(cmd *exec.Cmd, runAt time.Time) (id string, err error) {
+	payload, err := json.Marshal(newCommandSpec(cmd))
+	if err != nil {
+		return "", err
+	}
+	id = fmt.Sprintf("%s-%s-%s", time.Now().Format(time.RFC3339Nano), RandomString(8), e.poolId)
+	job := queue.Job{ID: id, PoolId: e.poolId, Payload: payload}
+	if err := e.backendOrDefault().Schedule(job, runAt); err != nil {
+		return "", err
+	}
+	e.logger.With(Field{"pool_id", e.poolId}, Field{"job_id", id}).Debugf("job scheduled for %s", runAt)
+	return id, nil
+}
+
+// ScheduleCron durably enqueues cmd every time spec next matches (standard
+// five-field cron syntax). The returned cron.EntryID identifies the entry
+// in the pool's cron scheduler; StopCron takes no ID and stops every entry
+// at once.
+func (e *ExecPool) ScheduleCron(cmd *exec.Cmd, spec string) (cron.EntryID, error) {
+	if e.cronRunner == nil {
+		e.cronRunner = cron.New()
+		e.cronRunner.Start()
+	}
+	return e.cronRunner.AddFunc(spec, func() {
+		if _, err := e.ScheduleCommand(cmd, time.Time{}); err != nil {
+			e.logger.With(Field{"pool_id", e.poolId}).Errorf("cron-triggered schedule failed: %v", err)
+		}
+	})
+}
+
+// StopCron stops the pool's cron scheduler, if ScheduleCron has started
+// one. Jobs already scheduled are unaffected.
+func (e *ExecPool) StopCron() {
+	if e.cronRunner != nil {
+		e.cronRunner.Stop()
+	}
+}
+
+// RunDaemon turns the pool into a long-lived consumer of its Backend,
+// fanning out across e.executors concurrent consumers (the same
+// concurrency NewExecPool was given): each repeatedly dequeues a ready
+// job, runs it with the pool's normal job logic, acks successes, nacks
+// failures for retry, and publishes results back through the Backend so a
+// separate process can call GetResults or the Backend's own GetResult. It
+// runs until ctx is canceled.
+func (e *ExecPool) RunDaemon(ctx context.Context) error {
+	backend := e.backendOrDefault()
+	e.ctx = ctx
+
+	if reclaim, ok := backend.(reclaimer); ok {
+		reclaimTicker := time.NewTicker(defaultReclaimInterval)
+		defer reclaimTicker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-reclaimTicker.C:
+					if err := reclaim.Reclaim(e.poolId); err != nil {
+						e.logger.With(Field{"pool_id", e.poolId}).Errorf("reclaiming abandoned jobs failed: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
+	executors := e.executors
+	if executors < 1 {
+		executors = 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(executors)
+	for i := 0; i < executors; i++ {
+		go func() {
+			defer wg.Done()
+			e.runDaemonConsumer(ctx, backend)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// runDaemonConsumer is one of RunDaemon's concurrent consumers: it polls
+// backend for a ready job, runs it, and acks/nacks/publishes its result,
+// until ctx is canceled.
+func (e *ExecPool) runDaemonConsumer(ctx context.Context, backend queue.Backend) {
+	ticker := time.NewTicker(defaultPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		job, err := backend.Dequeue(e.poolId)
+		if err == queue.ErrEmpty {
+			continue
+		}
+		if err != nil {
+			e.logger.With(Field{"pool_id", e.poolId}).Errorf("dequeue failed: %v", err)
+			continue
+		}
+
+		var spec commandSpec
+		if err := json.Unmarshal(job.Payload, &spec); err != nil {
+			e.logger.With(Field{"pool_id", e.poolId}, Field{"job_id", job.ID}).Errorf("decoding job failed: %v", err)
+			_ = backend.Nack(e.poolId, job.ID, err)
+			continue
+		}
+
+		request := CommandRequest{jobId: job.ID, command: spec.toCmd()}
+		result := e.runJob("daemon", request)
+		e.cmdOutputMu.Lock()
+		e.cmdOutput = append(e.cmdOutput, result)
+		e.cmdOutputMu.Unlock()
+
+		if result.RunError != nil {
+			_ = backend.Nack(e.poolId, job.ID, result.RunError)
+		} else {
+			_ = backend.Ack(e.poolId, job.ID)
+		}
+
+		durableResult := queue.Result{
+			JobId:      result.JobId,
+			StdOut:     result.StdOut,
+			StdErr:     result.StdErr,
+			ReturnCode: result.ReturnCode,
+		}
+		if result.RunError != nil {
+			durableResult.RunError = result.RunError.Error()
+		}
+		if err := backend.PutResult(e.poolId, durableResult); err != nil {
+			e.logger.With(Field{"pool_id", e.poolId}, Field{"job_id", job.ID}).Errorf("publishing result failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many live LogLine events a subscriber channel can
+// hold, beyond its replay, before it is considered slow and dropped.
+const subscriberBuffer = 256
+
+// replayBufferBytes bounds how much of a job's output a late Subscribe call
+// can replay.
+const replayBufferBytes = 64 * 1024
+
+// LogLine is one line of output from a job's stdout or stderr, delivered to
+// Subscribe callers as the command runs.
+type LogLine struct {
+	Stream string // "stdout" or "stderr"
+	Line   string
+	Time   time.Time
+}
+
+// logBroadcaster fans a job's output out to any number of subscribers,
+// dropping slow listeners rather than letting them block the job, and
+// keeps a bounded replay buffer so late subscribers can catch up.
+type logBroadcaster struct {
+	mu          sync.Mutex
+	subs        map[chan LogLine]struct{}
+	replay      []LogLine
+	replayBytes int
+	finished    bool
+	logger      Logger
+	lastStderr  string
+}
+
+func newLogBroadcaster(logger Logger) *logBroadcaster {
+	return &logBroadcaster{subs: make(map[chan LogLine]struct{}), logger: logger}
+}
+
+func (b *logBroadcaster) subscribe(jobId string) (<-chan LogLine, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan LogLine, len(b.replay)+subscriberBuffer)
+	for _, line := range b.replay {
+		ch <- line
+	}
+	if b.finished {
+		close(ch)
+		return ch, func() {}
+	}
+
+	b.subs[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+func (b *logBroadcaster) publish(jobId, stream, line string) {
+	entry := LogLine{Stream: stream, Line: line, Time: time.Now()}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if stream == "stderr" {
+		b.lastStderr = line
+	}
+
+	b.replay = append(b.replay, entry)
+	b.replayBytes += len(entry.Line)
+	for b.replayBytes > replayBufferBytes && len(b.replay) > 1 {
+		b.replayBytes -= len(b.replay[0].Line)
+		b.replay = b.replay[1:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- entry:
+		default:
+			b.logger.With(Field{"job_id", jobId}).Warnf("dropping slow log subscriber")
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *logBroadcaster) lastStderrLine() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastStderr
+}
+
+func (b *logBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished = true
+	for ch := range b.subs {
+		close(ch)
+	}
+	b.subs = make(map[chan LogLine]struct{})
+}
+
+// Subscribe returns a channel of LogLine events for jobId as they are
+// produced, along with a cancel func that must be called to stop receiving
+// and release the subscription. If the job has already finished, the
+// returned channel is pre-loaded with its replay buffer and then closed.
+func (e *ExecPool) Subscribe(jobId string) (<-chan LogLine, func()) {
+	return e.broadcasterFor(jobId).subscribe(jobId)
+}
+
+func (e *ExecPool) broadcasterFor(jobId string) *logBroadcaster {
+	e.broadcastersMu.Lock()
+	defer e.broadcastersMu.Unlock()
+	if e.broadcasters == nil {
+		e.broadcasters = make(map[string]*logBroadcaster)
+	}
+	b, ok := e.broadcasters[jobId]
+	if !ok {
+		b = newLogBroadcaster(e.logger)
+		e.broadcasters[jobId] = b
+	}
+	return b
+}
+
+// releaseBroadcaster drops jobId's broadcaster from the pool once the job
+// has resolved, so a long-lived pool (e.g. RunDaemon) does not retain every
+// job's replay buffer for the life of the process.
+func (e *ExecPool) releaseBroadcaster(jobId string) {
+	e.broadcastersMu.Lock()
+	defer e.broadcastersMu.Unlock()
+	delete(e.broadcasters, jobId)
+}
+
+// streamWriter tees everything written to it into buff (preserving the
+// existing CommandResult.StdOut/StdErr behavior) and, line by line, into
+// the job's broadcaster for live subscribers.
+//
+// It reads with bufio.Reader.ReadString rather than bufio.Scanner, which
+// caps at a fixed maximum token size: a single line longer than that cap
+// would make Scan stop reading for good, and since nothing else drains
+// the synchronous io.Pipe, the command's next Write would block forever.
+// ReadString has no such limit - its buffer simply grows to fit whatever
+// line it is given.
+func newStreamWriter(jobId, stream string, buff *bytes.Buffer, broadcaster *logBroadcaster) (io.Writer, func()) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader := bufio.NewReader(pr)
+		for {
+			line, err := reader.ReadString('\n')
+			if line != "" {
+				line = strings.TrimSuffix(line, "\n")
+				line = strings.TrimSuffix(line, "\r")
+				broadcaster.publish(jobId, stream, line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	closeFn := func() {
+		_ = pw.Close()
+		<-done
+	}
+	return io.MultiWriter(buff, pw), closeFn
+}
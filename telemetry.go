@@ -0,0 +1,183 @@
+// Copyright (c) 2023 Timothy Martin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package to the tracer/meter
+// providers, as the OpenTelemetry conventions expect.
+const instrumentationName = "github.com/tim-timpani/go-exec-pool"
+
+// telemetry holds everything WithTracer/WithMeter configure, plus the
+// queue-wait bookkeeping needed to compute pool_queue_wait_seconds.
+type telemetry struct {
+	tracer trace.Tracer
+
+	jobsTotal     metric.Int64Counter
+	jobDuration   metric.Float64Histogram
+	queueWait     metric.Float64Histogram
+	activeWorkers metric.Int64UpDownCounter
+	queueDepth    metric.Int64UpDownCounter
+
+	mu       sync.Mutex
+	enqueued map[string]time.Time
+}
+
+func newTelemetry() *telemetry {
+	return &telemetry{
+		tracer:   otel.Tracer(instrumentationName),
+		enqueued: make(map[string]time.Time),
+	}
+}
+
+// WithTracer installs provider as the source of the spans ExecPool creates
+// around enqueueing (pool.enqueue) and running (pool.job.run) each job.
+// When not called, ExecPool uses otel.GetTracerProvider(), which is a
+// no-op until the caller registers a global provider.
+func (e *ExecPool) WithTracer(provider trace.TracerProvider) *ExecPool {
+	e.telemetry.tracer = provider.Tracer(instrumentationName)
+	return e
+}
+
+// WithMeter installs provider as the source of ExecPool's metrics:
+// pool_jobs_total{status}, pool_job_duration_seconds,
+// pool_queue_wait_seconds, pool_active_workers, and pool_queue_depth. When
+// not called, these are no-ops.
+func (e *ExecPool) WithMeter(provider metric.MeterProvider) *ExecPool {
+	meter := provider.Meter(instrumentationName)
+	e.telemetry.jobsTotal, _ = meter.Int64Counter("pool_jobs_total")
+	e.telemetry.jobDuration, _ = meter.Float64Histogram("pool_job_duration_seconds")
+	e.telemetry.queueWait, _ = meter.Float64Histogram("pool_queue_wait_seconds")
+	e.telemetry.activeWorkers, _ = meter.Int64UpDownCounter("pool_active_workers")
+	e.telemetry.queueDepth, _ = meter.Int64UpDownCounter("pool_queue_depth")
+	return e
+}
+
+func argsHash(cmd *exec.Cmd) string {
+	sum := sha256.Sum256([]byte(strings.Join(cmd.Args, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// recordEnqueue starts the pool.enqueue span for jobId and notes the time,
+// so runJob can later report how long the job waited in queue.
+func (e *ExecPool) recordEnqueue(ctx context.Context, jobId string, cmd *exec.Cmd) {
+	_, span := e.telemetry.tracer.Start(ctx, "pool.enqueue", trace.WithAttributes(
+		attribute.String("pool.id", e.poolId),
+		attribute.String("job.id", jobId),
+		attribute.String("cmd.path", cmd.Path),
+		attribute.String("cmd.args_hash", argsHash(cmd)),
+	))
+	span.End()
+
+	e.telemetry.mu.Lock()
+	e.telemetry.enqueued[jobId] = time.Now()
+	e.telemetry.mu.Unlock()
+
+	if e.telemetry.queueDepth != nil {
+		e.telemetry.queueDepth.Add(ctx, 1)
+	}
+}
+
+// startJobSpan starts the pool.job.run span for a job about to execute,
+// injects its trace context into cmd's environment as OTEL_* env vars
+// (OTEL_TRACEPARENT, OTEL_TRACESTATE) so the child process can continue
+// the trace, and records pool_queue_wait_seconds/pool_active_workers.
+// attempt is the job's zero-based retry attempt number: pool_queue_depth
+// is only adjusted for the first attempt, since retries are rescheduled
+// internally and never pass back through recordEnqueue.
+func (e *ExecPool) startJobSpan(ctx context.Context, jobId, workerId string, cmd *exec.Cmd, attempt int) (context.Context, trace.Span) {
+	ctx, span := e.telemetry.tracer.Start(ctx, "pool.job.run", trace.WithAttributes(
+		attribute.String("pool.id", e.poolId),
+		attribute.String("job.id", jobId),
+		attribute.String("worker.id", workerId),
+		attribute.String("cmd.path", cmd.Path),
+		attribute.String("cmd.args_hash", argsHash(cmd)),
+	))
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 && cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	for key, value := range carrier {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("OTEL_%s=%s", strings.ToUpper(key), value))
+	}
+
+	if attempt == 0 {
+		e.telemetry.mu.Lock()
+		enqueuedAt, ok := e.telemetry.enqueued[jobId]
+		delete(e.telemetry.enqueued, jobId)
+		e.telemetry.mu.Unlock()
+		if ok && e.telemetry.queueWait != nil {
+			e.telemetry.queueWait.Record(ctx, time.Since(enqueuedAt).Seconds())
+		}
+		if e.telemetry.queueDepth != nil {
+			e.telemetry.queueDepth.Add(ctx, -1)
+		}
+	}
+	if e.telemetry.activeWorkers != nil {
+		e.telemetry.activeWorkers.Add(ctx, 1)
+	}
+
+	return ctx, span
+}
+
+// endJobSpan closes out the span started by startJobSpan, and records
+// pool_jobs_total and pool_job_duration_seconds for the attempt.
+func (e *ExecPool) endJobSpan(span trace.Span, start time.Time, result CommandResult) {
+	status := "success"
+	if result.RunError != nil {
+		status = "error"
+		span.RecordError(result.RunError)
+		span.SetStatus(codes.Error, result.RunError.Error())
+	} else if result.ReturnCode != 0 {
+		status = "failed"
+	}
+	span.SetAttributes(attribute.Int("exit_code", result.ReturnCode))
+	span.End()
+
+	if e.telemetry.activeWorkers != nil {
+		e.telemetry.activeWorkers.Add(context.Background(), -1)
+	}
+	if e.telemetry.jobsTotal != nil {
+		e.telemetry.jobsTotal.Add(context.Background(), 1, metric.WithAttributes(attribute.String("status", status)))
+	}
+	if e.telemetry.jobDuration != nil {
+		e.telemetry.jobDuration.Record(context.Background(), time.Since(start).Seconds())
+	}
+}